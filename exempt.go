@@ -0,0 +1,76 @@
+package fiber_limiter
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber"
+)
+
+// Exemption reports whether a request should bypass the limiter entirely.
+type Exemption func(*fiber.Ctx) bool
+
+// ExemptCIDRs returns an Exemption that matches when the request's peer
+// address falls inside any of the given CIDRs, e.g. an internal subnet.
+func ExemptCIDRs(cidrs ...string) Exemption {
+	nets := parseCIDRs(cidrs)
+
+	return func(ctx *fiber.Ctx) bool {
+		ip := net.ParseIP(ctx.IP())
+
+		return ip != nil && ipInNets(ip, nets)
+	}
+}
+
+// ExemptUserAgents returns an Exemption that matches when the request's
+// User-Agent header contains any of the given substrings, e.g. "Pingdom"
+// for a health-checker. Surrounding "*" wildcards are trimmed so the
+// common glob-style "*Pingdom*" keeps working; path.Match was tried here
+// before but treats "/" as a path separator that "*" won't cross, so it
+// fails to match real UA strings like "Pingdom.com_bot/1.0".
+func ExemptUserAgents(globs ...string) Exemption {
+	needles := make([]string, len(globs))
+	for i, g := range globs {
+		needles[i] = strings.Trim(g, "*")
+	}
+
+	return func(ctx *fiber.Ctx) bool {
+		ua := ctx.Get("User-Agent")
+
+		for _, n := range needles {
+			if n != "" && strings.Contains(ua, n) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, c := range cidrs {
+		if _, n, err := net.ParseCIDR(c); err == nil {
+			nets = append(nets, n)
+		} else if ip := net.ParseIP(c); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+
+	return nets
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package fiber_limiter
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// HeaderMode selects which rate-limit header convention the middleware
+// emits.
+type HeaderMode uint
+
+const (
+	// HeadersLegacy emits the existing X-RateLimit-* headers.
+	// Default.
+	HeadersLegacy HeaderMode = iota
+	// HeadersDraft emits the IETF draft-ietf-httpapi-ratelimit-headers-07
+	// RateLimit-* headers instead.
+	HeadersDraft
+	// HeadersBoth emits both header sets.
+	HeadersBoth
+)
+
+// retryAfter formats d as the whole number of seconds to wait, per RFC
+// 7231's delta-seconds form, instead of an absolute timestamp.
+func retryAfter(d time.Duration) string {
+	secs := int64(d.Seconds())
+	if secs < 0 {
+		secs = 0
+	}
+
+	return strconv.FormatInt(secs, 10)
+}
+
+// setRateLimitHeaders writes the configured header set(s) for a single
+// tier/window. name, when non-empty, is surfaced as the policy name in the
+// draft RateLimit-Policy field so multi-tier configs can tell windows
+// apart.
+func setRateLimitHeaders(ctx *fiber.Ctx, mode HeaderMode, name string, max int, remaining int64, period, resetAfter time.Duration) {
+	if mode == HeadersLegacy || mode == HeadersBoth {
+		ctx.Set("X-RateLimit-Limit", strconv.Itoa(max))
+		ctx.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		ctx.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(resetAfter).Unix(), 10))
+	}
+
+	if mode == HeadersDraft || mode == HeadersBoth {
+		policy := fmt.Sprintf("%d;w=%d", max, int64(period.Seconds()))
+		if name != "" {
+			policy = fmt.Sprintf(`%d;w=%d;name="%s"`, max, int64(period.Seconds()), name)
+		}
+
+		ctx.Set("RateLimit-Limit", strconv.Itoa(max))
+		ctx.Set("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		ctx.Set("RateLimit-Reset", retryAfter(resetAfter))
+		ctx.Set("RateLimit-Policy", policy)
+	}
+}
@@ -0,0 +1,52 @@
+package fiber_limiter
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber"
+)
+
+// DefaultForwardedHeader is read for the original client IP once the
+// direct peer is a trusted proxy.
+const DefaultForwardedHeader = "X-Forwarded-For"
+
+// defaultKeyFunc returns the stock Key function: the direct peer IP,
+// unless it's in trustedProxies, in which case the original client is
+// taken from forwardedHeader. This closes the spoofing hole where a
+// client sets X-Forwarded-For itself to dodge IP-based limiting, since
+// the header is only trusted coming from a known proxy hop.
+func defaultKeyFunc(trustedProxies []*net.IPNet, forwardedHeader string) func(*fiber.Ctx) string {
+	return func(ctx *fiber.Ctx) string {
+		peer := net.ParseIP(ctx.IP())
+		if peer == nil || len(trustedProxies) == 0 || !ipInNets(peer, trustedProxies) {
+			return ctx.IP()
+		}
+
+		fwd := ctx.Get(forwardedHeader)
+		if fwd == "" {
+			return ctx.IP()
+		}
+
+		// The header is appended to right-to-left by each proxy hop
+		// ("<spoofable>, <real client>, <trusted proxy>"), so walk it
+		// from the right and return the first entry that isn't itself a
+		// trusted proxy. Walking left to right would return the
+		// left-most, client-supplied value instead, defeating the point.
+		hops := strings.Split(fwd, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				continue
+			}
+
+			if !ipInNets(ip, trustedProxies) {
+				return hop
+			}
+		}
+
+		return strings.TrimSpace(hops[0])
+	}
+}
@@ -3,7 +3,6 @@ package fiber_limiter
 import (
 	"errors"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v7"
@@ -19,8 +18,10 @@ const (
 
 // Config ...
 type Config struct {
-	// Rediser
-	Rediser *redis.Client
+	// Rediser accepts a plain *redis.Client as well as redis.UniversalClient
+	// implementations (*redis.ClusterClient, *redis.Ring, failover/Sentinel
+	// clients) for HA/sharded deployments.
+	Rediser redis.UniversalClient
 
 	// Max number of recent connections
 	// Default: 10
@@ -49,6 +50,21 @@ type Config struct {
 	// Default: false
 	SkipOnError bool
 
+	// SkipFailedRequests, if true, does not count a request against the
+	// limit when the response status code is >= 400. The request still
+	// passes through Allow (so a client can't use failing requests to
+	// bypass the limiter), but the counter is refunded afterwards.
+	// Default: false
+	SkipFailedRequests bool
+
+	// SkipSuccessfulRequests, if true, does not count a request against
+	// the limit when the response status code is < 400. Works the same
+	// way as SkipFailedRequests but for the opposite outcome.
+	// Both options apply to the single Max/Burst/Period limit only;
+	// requests checked against Rules or Resolver are never refunded.
+	// Default: false
+	SkipSuccessfulRequests bool
+
 	// Period
 	Period time.Duration
 
@@ -57,9 +73,8 @@ type Config struct {
 	Filter func(*fiber.Ctx) bool
 
 	// Key allows to use a custom handler to create custom keys
-	// Default: func(ctx *fiber.Ctx) string {
-	//   return ctx.IP()
-	// }
+	// Default: ctx.IP(), or the first untrusted hop of ForwardedHeader
+	// when the direct peer is in TrustedProxies
 	Key func(*fiber.Ctx) string
 
 	// Handler is called when a request hits the limit
@@ -73,6 +88,68 @@ type Config struct {
 	//   ctx.Status(http.StatusInternalServerError).SendString(err.Error())
 	// }
 	ErrHandler func(error, *fiber.Ctx)
+
+	// Rules, when set, replaces the single Max/Burst/Period limit with a
+	// list of tiers evaluated independently, e.g. "10 rps burst, 1000/hr,
+	// 10000/day". A request is rejected if any rule denies it.
+	// Default: nil
+	Rules []Rule
+
+	// Resolver looks up the Rules to apply per request, e.g. per
+	// authenticated user or per plan. Takes precedence over Rules.
+	// Default: nil
+	Resolver Resolver
+
+	// HeaderMode selects the X-RateLimit-* legacy headers, the IETF
+	// draft-07 RateLimit-* headers, or both.
+	// Default: HeadersLegacy
+	HeaderMode HeaderMode
+
+	// Name identifies this limit's window, surfaced as the policy name
+	// in the draft RateLimit-Policy header. Ignored in legacy mode.
+	// Default: ""
+	Name string
+
+	// Fallback is consulted for the affected key when Redis errors,
+	// instead of the binary SkipOnError choice of allow-all or 500. Once
+	// Redis errors once, it is skipped for FallbackBackoff so Fallback
+	// takes every request during the blip instead of Redis timing out on
+	// each one.
+	// Default: nil
+	Fallback Store
+
+	// FallbackBackoff is how long to keep serving from Fallback after a
+	// Redis error before re-probing Redis. Ignored if Fallback is nil.
+	// Default: 5 * time.Second
+	FallbackBackoff time.Duration
+
+	// Cost reports how many tokens a request consumes, for routes that
+	// should count for more than one hit, e.g. bulk endpoints or
+	// expensive searches.
+	// Default: func(*fiber.Ctx) int64 { return 1 }
+	Cost func(*fiber.Ctx) int64
+
+	// Exempt bypasses the limiter entirely when any of these report true,
+	// e.g. ExemptCIDRs/ExemptUserAgents for internal health checkers.
+	// Default: nil
+	Exempt []Exemption
+
+	// OnExempt, when set, is called for every request that bypasses the
+	// limiter via Exempt, e.g. to increment a metrics counter.
+	// Default: nil
+	OnExempt func(*fiber.Ctx)
+
+	// TrustedProxies lists CIDRs (or bare IPs) of proxies allowed to set
+	// ForwardedHeader. The default Key only trusts it when the direct
+	// peer is one of these, otherwise an attacker could spoof it to
+	// dodge IP-based limiting.
+	// Default: nil
+	TrustedProxies []string
+
+	// ForwardedHeader is the header the default Key reads for the
+	// original client IP once the direct peer is a trusted proxy.
+	// Default: "X-Forwarded-For"
+	ForwardedHeader string
 }
 
 // New ...
@@ -93,10 +170,12 @@ func New(config Config) func(*fiber.Ctx) {
 		}
 	}
 
+	if config.ForwardedHeader == "" {
+		config.ForwardedHeader = DefaultForwardedHeader
+	}
+
 	if config.Key == nil {
-		config.Key = func(ctx *fiber.Ctx) string {
-			return ctx.IP()
-		}
+		config.Key = defaultKeyFunc(parseCIDRs(config.TrustedProxies), config.ForwardedHeader)
 	}
 
 	if config.Algorithm == 0 {
@@ -127,7 +206,16 @@ func New(config Config) func(*fiber.Ctx) {
 		config.StatusCode = http.StatusTooManyRequests
 	}
 
-	limiter := go_limiter.NewLimiter(config.Rediser)
+	if config.FallbackBackoff == 0 {
+		config.FallbackBackoff = 5 * time.Second
+	}
+
+	if config.Cost == nil {
+		config.Cost = func(*fiber.Ctx) int64 { return 1 }
+	}
+
+	limiter := newAllower(config.Rediser, config.Prefix)
+	degraded := &degradation{}
 	limit := &go_limiter.Limit{
 		Period:    config.Period,
 		Algorithm: config.Algorithm,
@@ -135,9 +223,6 @@ func New(config Config) func(*fiber.Ctx) {
 		Burst:     int64(config.Burst),
 	}
 
-	// override default limiter prefix
-	limiter.Prefix = config.Prefix
-
 	return func(ctx *fiber.Ctx) {
 		// Filter request to skip middleware
 		if config.Filter != nil && config.Filter(ctx) {
@@ -146,7 +231,57 @@ func New(config Config) func(*fiber.Ctx) {
 			return
 		}
 
-		result, err := limiter.Allow(config.Key(ctx), limit)
+		for _, exempt := range config.Exempt {
+			if exempt(ctx) {
+				if config.OnExempt != nil {
+					config.OnExempt(ctx)
+				}
+
+				ctx.Next()
+
+				return
+			}
+		}
+
+		key := config.Key(ctx)
+		cost := config.Cost(ctx)
+
+		// Tiered limits take over entirely; they manage their own Redis
+		// keys and headers since each tier is checked independently.
+		if config.Resolver != nil || len(config.Rules) > 0 {
+			rules := config.Rules
+			if config.Resolver != nil {
+				rules = config.Resolver(ctx)
+			}
+
+			evaluateRules(config, limiter, degraded, key, rules, cost, ctx)
+
+			return
+		}
+
+		if cost > int64(config.Burst) {
+			config.Handler(ctx)
+			ctx.Set("Retry-After", retryAfter(config.Period))
+
+			return
+		}
+
+		var result *go_limiter.Result
+		var err error
+		servedByFallback := false
+
+		if config.Fallback != nil && degraded.tripped() {
+			result, err = config.Fallback.Allow(key, cost)
+			servedByFallback = true
+		} else {
+			result, err = limiter.AllowN(key, limit, cost)
+			if err != nil && config.Fallback != nil {
+				degraded.trip(config.FallbackBackoff)
+				result, err = config.Fallback.Allow(key, cost)
+				servedByFallback = true
+			}
+		}
+
 		// if we have error lets just pass the request
 		if err != nil {
 			if config.SkipOnError {
@@ -164,16 +299,40 @@ func New(config Config) func(*fiber.Ctx) {
 		if !result.Allowed {
 			// Call Handler func
 			config.Handler(ctx)
-			// Return response with Retry-After header
-			// https://tools.ietf.org/html/rfc6584
-			ctx.Set("Retry-After", strconv.FormatInt(time.Now().Add(result.RetryAfter).Unix(), 10))
+			// Return response with Retry-After header, as delta-seconds
+			// per https://tools.ietf.org/html/rfc7231#section-7.1.3
+			ctx.Set("Retry-After", retryAfter(result.RetryAfter))
 			return
 		}
 
 		// We can continue, update RateLimit headers
-		ctx.Set("X-RateLimit-Limit", strconv.Itoa(config.Max))
-		ctx.Set("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
-		ctx.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(result.ResetAfter).Unix(), 10))
+		setRateLimitHeaders(ctx, config.HeaderMode, config.Name, config.Max, result.Remaining, config.Period, result.ResetAfter)
+
+		// When skipping is configured we need to see the outcome of the
+		// handler before deciding whether this request should count.
+		if config.SkipFailedRequests || config.SkipSuccessfulRequests {
+			ctx.Next()
+
+			failed := ctx.Fasthttp.Response.StatusCode() >= http.StatusBadRequest
+			if (config.SkipFailedRequests && failed) || (config.SkipSuccessfulRequests && !failed) {
+				// Refund against whichever backend actually served the
+				// Allow above; Redis may have recovered (or degraded)
+				// between the two calls, so this can't just assume limiter.
+				var rerr error
+				if servedByFallback {
+					rerr = config.Fallback.Refund(key, cost)
+				} else {
+					rerr = limiter.Refund(key, limit, cost)
+				}
+
+				if rerr != nil {
+					config.ErrHandler(rerr, ctx)
+				}
+			}
+
+			return
+		}
+
 		// Bye!
 		ctx.Next()
 	}
@@ -1,9 +1,16 @@
 package fiber_limiter
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
 	"github.com/gofiber/fiber"
+	"github.com/shareed2k/go_limiter"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,7 +22,242 @@ func TestPanicOnNilRediser(t *testing.T) {
 	assert.Panics(t, ff, "should panic on rediser nil")
 }
 
-func TestSkipOnError(t *testing.T) {
+func TestRuleSuffixIsUniquePerTier(t *testing.T) {
+	a := Rule{Max: 10, Burst: 10, Period: time.Second}
+	b := Rule{Max: 1000, Burst: 1000, Period: time.Hour}
+
+	assert.NotEqual(t, a.suffix(), b.suffix())
+}
+
+func TestRetryAfterIsDeltaSeconds(t *testing.T) {
+	assert.Equal(t, "5", retryAfter(5*time.Second))
+	assert.Equal(t, "0", retryAfter(-time.Second))
+}
+
+func TestNewAllowerPicksUniversalLimiterForClusterClients(t *testing.T) {
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:6379"}})
+
+	_, ok := newAllower(client, DefaultKeyPrefix).(*universalLimiter)
+	assert.True(t, ok)
+}
+
+func TestParseCIDRsAcceptsBareIPs(t *testing.T) {
+	nets := parseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"})
+
+	assert.True(t, ipInNets(net.ParseIP("10.1.2.3"), nets))
+	assert.True(t, ipInNets(net.ParseIP("192.168.1.1"), nets))
+	assert.False(t, ipInNets(net.ParseIP("8.8.8.8"), nets))
+}
+
+func TestMemoryStoreBlocksAfterMax(t *testing.T) {
+	store := NewMemoryStore(2, time.Minute)
+
+	first, err := store.Allow("k", 1)
+	assert.NoError(t, err)
+	assert.True(t, first.Allowed)
+
+	second, err := store.Allow("k", 1)
+	assert.NoError(t, err)
+	assert.True(t, second.Allowed)
+
+	third, err := store.Allow("k", 1)
+	assert.NoError(t, err)
+	assert.False(t, third.Allowed)
+}
+
+// newMiniredisClient starts an in-process miniredis server and returns a
+// client for it, for tests that need a real (if fake) Redis to run the Lua
+// scripts against. *redis.Client satisfies redis.UniversalClient, so this
+// also exercises the same code path used for Cluster/Sentinel clients.
+func newMiniredisClient(t *testing.T) redis.UniversalClient {
+	t.Helper()
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+// TestSlidingWindowMatchesGoLimiter checks universalLimiter's sliding-window
+// script against go_limiter's own (miniredis-backed) sliding window
+// implementation request for request, to prove the two stay in lockstep
+// rather than silently diverging into a different (e.g. fixed-window)
+// algorithm.
+func TestSlidingWindowMatchesGoLimiter(t *testing.T) {
+	client := newMiniredisClient(t)
+	reference := go_limiter.NewLimiter(client)
+	ours := newAllower(client, "parity")
+
+	limit := &go_limiter.Limit{
+		Algorithm: SlidingWindowAlgorithm,
+		Rate:      5,
+		Period:    time.Minute,
+		Burst:     5,
+	}
+
+	for i := 0; i < 6; i++ {
+		want, err := reference.Allow("key", limit)
+		assert.NoError(t, err)
+
+		got, err := ours.AllowN("key", limit, 1)
+		assert.NoError(t, err)
+
+		assert.Equal(t, want.Allowed, got.Allowed, "request %d", i)
+		assert.Equal(t, want.Remaining, got.Remaining, "request %d", i)
+	}
+}
+
+// TestGCRAMatchesGoLimiter is the GCRA equivalent of
+// TestSlidingWindowMatchesGoLimiter.
+func TestGCRAMatchesGoLimiter(t *testing.T) {
+	client := newMiniredisClient(t)
+	reference := go_limiter.NewLimiter(client)
+	ours := newAllower(client, "parity")
+
+	limit := &go_limiter.Limit{
+		Algorithm: GCRAAlgorithm,
+		Rate:      5,
+		Period:    time.Minute,
+		Burst:     5,
+	}
+
+	for i := 0; i < 6; i++ {
+		want, err := reference.Allow("key", limit)
+		assert.NoError(t, err)
+
+		got, err := ours.AllowN("key", limit, 1)
+		assert.NoError(t, err)
+
+		assert.Equal(t, want.Allowed, got.Allowed, "request %d", i)
+	}
+}
+
+// TestExpensiveCallBlocksSubsequentCheapCall confirms a single high-cost
+// request consumes enough of the window that a follow-up cost-1 request is
+// denied, for both algorithms.
+func TestExpensiveCallBlocksSubsequentCheapCall(t *testing.T) {
+	for _, algo := range []uint{SlidingWindowAlgorithm, GCRAAlgorithm} {
+		client := newMiniredisClient(t)
+		limiter := newAllower(client, "cost")
+		limit := &go_limiter.Limit{Algorithm: algo, Rate: 5, Period: time.Minute, Burst: 5}
+
+		first, err := limiter.AllowN("key", limit, 5)
+		assert.NoError(t, err)
+		assert.True(t, first.Allowed, "algorithm %d", algo)
+
+		second, err := limiter.AllowN("key", limit, 1)
+		assert.NoError(t, err)
+		assert.False(t, second.Allowed, "algorithm %d", algo)
+	}
+}
+
+func TestRuleBurstDefaultsToMax(t *testing.T) {
+	r := Rule{Max: 1000, Period: time.Hour}
+
+	assert.Equal(t, int64(1000), r.effectiveBurst())
+	assert.Equal(t, int64(1000), r.toLimit().Burst)
+}
+
+func TestRuleSuffixDiffersByAlgorithm(t *testing.T) {
+	a := Rule{Max: 10, Burst: 10, Period: time.Second, Algorithm: SlidingWindowAlgorithm}
+	b := Rule{Max: 10, Burst: 10, Period: time.Second, Algorithm: GCRAAlgorithm}
+
+	assert.NotEqual(t, a.suffix(), b.suffix())
+}
+
+// TestRulesFallBackOnRedisError checks that evaluateRules degrades to
+// Config.Fallback the same way the single-limit path does, rather than
+// erroring out for every request configured with Rules/Resolver.
+func TestRulesFallBackOnRedisError(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Close() // every call against client now fails
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Rediser:  client,
+		Rules:    []Rule{{Max: 10, Burst: 10, Period: time.Minute}},
+		Fallback: NewMemoryStore(1, time.Minute),
+	}))
+	app.Get("/", func(ctx *fiber.Ctx) { ctx.SendStatus(http.StatusOK) })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Fallback's MemoryStore has max=1, so the second request should now
+	// be rejected by the fallback instead of erroring.
+	req2 := httptest.NewRequest("GET", "/", nil)
+	resp2, err := app.Test(req2)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp2.StatusCode)
+}
+
+// TestSkipFailedRequestsRefundsTheCount drives a real fiber app end to end:
+// a request that the handler fails should be refunded so it doesn't count
+// against the limit, while a request that succeeds should.
+func TestSkipFailedRequestsRefundsTheCount(t *testing.T) {
+	client := newMiniredisClient(t)
+
 	app := fiber.New()
+	app.Use(New(Config{
+		Rediser:            client,
+		Max:                1,
+		Burst:              1,
+		Period:             time.Minute,
+		SkipFailedRequests: true,
+	}))
+	app.Get("/fail", func(ctx *fiber.Ctx) { ctx.SendStatus(http.StatusInternalServerError) })
+	app.Get("/ok", func(ctx *fiber.Ctx) { ctx.SendStatus(http.StatusOK) })
+
+	// A failing request consumes the one allowed slot, but is refunded...
+	resp, err := app.Test(httptest.NewRequest("GET", "/fail", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// ...so a subsequent request still has its full allowance.
+	resp2, err := app.Test(httptest.NewRequest("GET", "/ok", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp2.StatusCode)
+
+	// But now the allowance really is spent.
+	resp3, err := app.Test(httptest.NewRequest("GET", "/ok", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp3.StatusCode)
+}
+
+// TestSkipFailedRequestsRefundsThroughFallback checks that when Redis is
+// down and Config.Fallback served the original Allow, the compensating
+// refund is issued against Fallback too - not against the (still-down)
+// Redis-backed limiter, which would just error.
+func TestSkipFailedRequestsRefundsThroughFallback(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Close() // every call against client now fails
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Rediser:            client,
+		Max:                1,
+		Burst:              1,
+		Period:             time.Minute,
+		SkipFailedRequests: true,
+		Fallback:           NewMemoryStore(1, time.Minute),
+	}))
+	app.Get("/fail", func(ctx *fiber.Ctx) { ctx.SendStatus(http.StatusInternalServerError) })
+	app.Get("/ok", func(ctx *fiber.Ctx) { ctx.SendStatus(http.StatusOK) })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/fail", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
 
+	resp2, err := app.Test(httptest.NewRequest("GET", "/ok", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp2.StatusCode)
 }
@@ -0,0 +1,49 @@
+package fiber_limiter
+
+import (
+	"github.com/go-redis/redis/v7"
+	"github.com/shareed2k/go_limiter"
+)
+
+// luaRefundGCRA shifts the stored TAT (theoretical arrival time) back by
+// cost emission intervals, the inverse of what allowGCRA does when it
+// grants a request of that cost.
+var luaRefundGCRA = redis.NewScript(`
+local key = KEYS[1]
+local emissionIntervalMs = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local tat = redis.call("GET", key)
+if tat then
+    redis.call("SET", key, tat - emissionIntervalMs * cost, "KEEPTTL")
+end
+return redis.status_reply("OK")
+`)
+
+// luaRefundSlidingWindow drops the cost most-recently-added entries from
+// the sorted-set event log luaSlidingWindowAllow maintains, the inverse of
+// the ZADDs it does when it grants a request of that cost.
+var luaRefundSlidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local cost = tonumber(ARGV[1])
+redis.call("ZREMRANGEBYRANK", key, -cost, -1)
+return redis.status_reply("OK")
+`)
+
+// Refund compensates the counter for key after a request already passed
+// Allow/AllowN, used by SkipFailedRequests/SkipSuccessfulRequests to avoid
+// charging the limit for responses that shouldn't count. It goes through
+// the same client/key layout AllowN used, and subtracts the same cost the
+// original call consumed.
+func (u *universalLimiter) Refund(key string, limit *go_limiter.Limit, cost int64) error {
+	if cost <= 0 {
+		return nil
+	}
+
+	fullKey := u.prefix + ":" + key
+
+	if limit.Algorithm == GCRAAlgorithm {
+		return luaRefundGCRA.Run(u.client, []string{fullKey}, emissionIntervalMs(limit), cost).Err()
+	}
+
+	return luaRefundSlidingWindow.Run(u.client, []string{fullKey}, cost).Err()
+}
@@ -0,0 +1,156 @@
+package fiber_limiter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"github.com/shareed2k/go_limiter"
+)
+
+// Rule describes a single rate-limit tier, e.g. "10 rps burst" or
+// "1000 requests per hour". Attach several Rules to a Config to express
+// layered limits such as burst + hourly + daily caps in one middleware.
+type Rule struct {
+	// Max number of requests allowed per Period.
+	Max int
+
+	// Burst is the largest cost a single request may have, and for GCRA
+	// also the bucket size (tokens that can be spent at once). It is not
+	// added to Max.
+	// Default: Max
+	Burst int
+
+	// Period over which Max/Burst apply.
+	Period time.Duration
+
+	// Algorithm to use for this rule.
+	// Default: SlidingWindowAlgorithm
+	Algorithm uint
+
+	// Match reports whether this rule applies to the current request.
+	// Optional. Default: always matches.
+	Match func(*fiber.Ctx) bool
+
+	// Name identifies this tier's window, surfaced as the policy name in
+	// the draft RateLimit-Policy header, e.g. "burst" or "daily".
+	// Default: ""
+	Name string
+}
+
+// Resolver looks up the Rules that apply to a request, e.g. per
+// authenticated user or per plan. When set it takes precedence over
+// Config.Rules.
+type Resolver func(*fiber.Ctx) []Rule
+
+// effectiveBurst returns Burst, defaulting to Max when unset. Burst has no
+// meaning on its own separate from the tier's rate, so a zero Burst with a
+// non-zero Max would otherwise reject every request with cost > 0.
+func (r Rule) effectiveBurst() int64 {
+	if r.Burst == 0 {
+		return int64(r.Max)
+	}
+
+	return int64(r.Burst)
+}
+
+// effectiveAlgorithm returns Algorithm, defaulting to SlidingWindowAlgorithm.
+func (r Rule) effectiveAlgorithm() uint {
+	if r.Algorithm == 0 {
+		return SlidingWindowAlgorithm
+	}
+
+	return r.Algorithm
+}
+
+// suffix builds a Redis key suffix that is unique per tier so that rules
+// with different Max/Burst/Period/Algorithm don't share a counter.
+func (r Rule) suffix() string {
+	return fmt.Sprintf("%d:%d:%d:%d", r.Max, r.effectiveBurst(), r.Period, r.effectiveAlgorithm())
+}
+
+func (r Rule) toLimit() *go_limiter.Limit {
+	return &go_limiter.Limit{
+		Period:    r.Period,
+		Algorithm: r.effectiveAlgorithm(),
+		Rate:      int64(r.Max),
+		Burst:     r.effectiveBurst(),
+	}
+}
+
+// evaluateRules runs every applicable rule against Redis (or, during an
+// outage, Config.Fallback - same degradation as the single-limit path in
+// New()) under its own key suffix, and rejects as soon as one of them
+// denies. cost is passed through to each rule the same way the
+// single-limit path does, so Config.Cost still applies when
+// Rules/Resolver is configured. The headers reported back describe the
+// most restrictive rule that still allowed the request, i.e. the one with
+// the fewest remaining hits.
+//
+// Note: a request that passes a looser tier but is then denied by a
+// stricter one has already been counted against the looser tier, with no
+// refund. Refunding would need a second round-trip per already-passed
+// tier on every rejection, so this is an accepted tradeoff rather than a
+// bug - rejected requests still consume a little of the allowance on the
+// tiers that let them through.
+func evaluateRules(config Config, limiter allower, degraded *degradation, key string, rules []Rule, cost int64, ctx *fiber.Ctx) {
+	var tightest *go_limiter.Result
+	var tightestRule Rule
+
+	for _, rule := range rules {
+		if rule.Match != nil && !rule.Match(ctx) {
+			continue
+		}
+
+		if cost > rule.effectiveBurst() {
+			config.Handler(ctx)
+			ctx.Set("Retry-After", retryAfter(rule.Period))
+
+			return
+		}
+
+		ruleKey := key + ":" + rule.suffix()
+		limit := rule.toLimit()
+
+		var result *go_limiter.Result
+		var err error
+
+		if config.Fallback != nil && degraded.tripped() {
+			result, err = config.Fallback.Allow(ruleKey, cost)
+		} else {
+			result, err = limiter.AllowN(ruleKey, limit, cost)
+			if err != nil && config.Fallback != nil {
+				degraded.trip(config.FallbackBackoff)
+				result, err = config.Fallback.Allow(ruleKey, cost)
+			}
+		}
+
+		if err != nil {
+			if config.SkipOnError {
+				continue
+			}
+
+			config.ErrHandler(err, ctx)
+
+			return
+		}
+
+		if !result.Allowed {
+			config.Handler(ctx)
+			ctx.Set("Retry-After", retryAfter(result.RetryAfter))
+
+			return
+		}
+
+		if tightest == nil || result.Remaining < tightest.Remaining {
+			tightest = result
+			tightestRule = rule
+		}
+	}
+
+	if tightest != nil {
+		setRateLimitHeaders(ctx, config.HeaderMode, tightestRule.Name, tightestRule.Max, tightest.Remaining, tightestRule.Period, tightest.ResetAfter)
+	}
+
+	ctx.Next()
+}
@@ -0,0 +1,123 @@
+package fiber_limiter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shareed2k/go_limiter"
+)
+
+// Store is a pluggable rate-limit backend keyed by the same string
+// Config.Key produces, for Config.Fallback to keep protecting the origin
+// during Redis outages. It's deliberately smaller than the Redis-backed
+// allower (no per-call Algorithm/Period, since a fallback store runs its
+// own fixed window) and isn't implicitly satisfied by it; MemoryStore is
+// the only built-in implementation.
+type Store interface {
+	Allow(key string, cost int64) (*go_limiter.Result, error)
+	Refund(key string, cost int64) error
+	Reset(key string) error
+}
+
+// memoryWindow is a single key's fixed-window counter.
+type memoryWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// MemoryStore is an in-process Store backed by a fixed-window counter. It
+// trades precision for zero external dependencies, which is the point: it
+// only needs to hold the line for as long as Redis is unavailable.
+type MemoryStore struct {
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+
+	max    int
+	period time.Duration
+}
+
+// NewMemoryStore returns a Store suitable for Config.Fallback that grants
+// up to max tokens per key in each fixed window of length period. max and
+// period are independent of the Redis limit's Max and Period.
+func NewMemoryStore(max int, period time.Duration) *MemoryStore {
+	return &MemoryStore{
+		windows: make(map[string]*memoryWindow),
+		max:     max,
+		period:  period,
+	}
+}
+
+func (m *MemoryStore) Allow(key string, cost int64) (*go_limiter.Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	w, ok := m.windows[key]
+	if !ok || now.After(w.resetAt) {
+		w = &memoryWindow{resetAt: now.Add(m.period)}
+		m.windows[key] = w
+	}
+
+	w.count += int(cost)
+
+	remaining := int64(m.max - w.count)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	resetAfter := w.resetAt.Sub(now)
+
+	return &go_limiter.Result{
+		Allowed:    w.count <= m.max,
+		Remaining:  remaining,
+		RetryAfter: resetAfter,
+		ResetAfter: resetAfter,
+	}, nil
+}
+
+// Refund compensates the window for key after a request already passed
+// Allow, the same way universalLimiter.Refund does for the Redis-backed
+// path, so Skip*Requests degrades cleanly while Fallback is serving
+// traffic. It's a no-op once the window has already rolled over, since
+// there's nothing left to compensate.
+func (m *MemoryStore) Refund(key string, cost int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.windows[key]
+	if !ok || time.Now().After(w.resetAt) {
+		return nil
+	}
+
+	w.count -= int(cost)
+	if w.count < 0 {
+		w.count = 0
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.windows, key)
+
+	return nil
+}
+
+// degradation tracks whether Redis is currently considered unhealthy so we
+// stop hammering it with doomed requests once it starts erroring, and
+// re-probe it after Config.FallbackBackoff instead of on every request.
+type degradation struct {
+	retryAt int64 // unix nano, accessed atomically
+}
+
+func (d *degradation) tripped() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&d.retryAt)
+}
+
+func (d *degradation) trip(backoff time.Duration) {
+	atomic.StoreInt64(&d.retryAt, time.Now().Add(backoff).UnixNano())
+}
@@ -0,0 +1,176 @@
+package fiber_limiter
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/shareed2k/go_limiter"
+)
+
+// allower is the limiter backend used by New(). A single implementation,
+// universalLimiter, serves every redis.UniversalClient shape (plain
+// client, Cluster, Sentinel/failover) so a given Config enforces the same
+// algorithm and counts against the same key layout regardless of which
+// client shape it was wired up with.
+type allower interface {
+	Allow(key string, limit *go_limiter.Limit) (*go_limiter.Result, error)
+	AllowN(key string, limit *go_limiter.Limit, cost int64) (*go_limiter.Result, error)
+	Refund(key string, limit *go_limiter.Limit, cost int64) error
+}
+
+func newAllower(rediser redis.UniversalClient, prefix string) allower {
+	return &universalLimiter{client: rediser, prefix: prefix}
+}
+
+var _ allower = (*universalLimiter)(nil)
+
+// luaSlidingWindowAllow is a sorted-set event log: each allowed request is
+// recorded at its own timestamp and entries older than the period are
+// trimmed before counting, which is what go_limiter's own
+// sliding_window_lua.go does. A fixed-window INCRBY+PEXPIRE counter was
+// tried here before, but that's a different algorithm (it lets a full
+// burst through again the instant the window rolls over, doubling the
+// effective rate at the boundary) and shouldn't be labeled "sliding
+// window".
+var luaSlidingWindowAllow = redis.NewScript(`
+redis.replicate_commands()
+
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local periodMs = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local now = redis.call("TIME")
+local nowMs = (tonumber(now[1]) * 1000) + math.floor(tonumber(now[2]) / 1000)
+local clearBefore = nowMs - periodMs
+
+redis.call("ZREMRANGEBYSCORE", key, "0", clearBefore)
+
+local count = redis.call("ZCARD", key)
+
+local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+local retryAfterMs = 0
+if #oldest > 0 then
+    retryAfterMs = periodMs - (nowMs - tonumber(oldest[2]))
+end
+
+if count + cost > rate then
+    return {0, rate - count, retryAfterMs}
+end
+
+for i = 1, cost do
+    redis.call("ZADD", key, nowMs, nowMs .. "-" .. i .. "-" .. math.random())
+end
+redis.call("PEXPIRE", key, periodMs)
+
+return {1, rate - (count + cost), retryAfterMs}
+`)
+
+var luaGCRAAllow = redis.NewScript(`
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local emissionIntervalMs = tonumber(ARGV[2])
+local nowMs = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local tat = tonumber(redis.call("GET", key))
+if tat == nil or tat < nowMs then
+    tat = nowMs
+end
+
+local increment = emissionIntervalMs * cost
+local newTat = tat + increment
+local allowAt = newTat - burst * emissionIntervalMs
+
+local allowed = 0
+local retryAfterMs = allowAt - nowMs
+if allowAt <= nowMs then
+    allowed = 1
+    redis.call("SET", key, newTat, "PX", emissionIntervalMs * (burst + 1))
+    retryAfterMs = 0
+end
+
+local remaining = math.floor((nowMs - allowAt) / emissionIntervalMs)
+if remaining < 0 then
+    remaining = 0
+end
+if remaining > burst then
+    remaining = burst
+end
+
+return {allowed, remaining, retryAfterMs}
+`)
+
+// universalLimiter implements both algorithms with Lua scripts against any
+// redis.UniversalClient (plain client, Cluster, Sentinel/failover, ...).
+type universalLimiter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func (u *universalLimiter) Allow(key string, limit *go_limiter.Limit) (*go_limiter.Result, error) {
+	return u.AllowN(key, limit, 1)
+}
+
+func (u *universalLimiter) AllowN(key string, limit *go_limiter.Limit, cost int64) (*go_limiter.Result, error) {
+	fullKey := u.prefix + ":" + key
+
+	if limit.Algorithm == GCRAAlgorithm {
+		return allowGCRA(u.client, fullKey, limit, cost)
+	}
+
+	return allowSlidingWindow(u.client, fullKey, limit, cost)
+}
+
+// emissionIntervalMs is the GCRA token spacing, floored at 1ms so high
+// rates (e.g. Period/Rate < 1ms) don't collapse the interval to zero and
+// divide-by-zero in the Lua scripts.
+func emissionIntervalMs(limit *go_limiter.Limit) int64 {
+	interval := limit.Period.Milliseconds() / limit.Rate
+	if interval < 1 {
+		interval = 1
+	}
+
+	return interval
+}
+
+func allowSlidingWindow(client redis.UniversalClient, key string, limit *go_limiter.Limit, cost int64) (*go_limiter.Result, error) {
+	res, err := luaSlidingWindowAllow.Run(client, []string{key}, limit.Rate, limit.Period.Milliseconds(), cost).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	vals := res.([]interface{})
+	allowed := vals[0].(int64) == 1
+	remaining := vals[1].(int64)
+	retryAfterMs := vals[2].(int64)
+
+	return &go_limiter.Result{
+		Allowed:    allowed,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(retryAfterMs) * time.Millisecond,
+		ResetAfter: limit.Period,
+	}, nil
+}
+
+func allowGCRA(client redis.UniversalClient, key string, limit *go_limiter.Limit, cost int64) (*go_limiter.Result, error) {
+	emissionInterval := emissionIntervalMs(limit)
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	res, err := luaGCRAAllow.Run(client, []string{key}, limit.Burst, emissionInterval, now, cost).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	vals := res.([]interface{})
+	allowed := vals[0].(int64) == 1
+	remaining := vals[1].(int64)
+	retryAfterMs := vals[2].(int64)
+
+	return &go_limiter.Result{
+		Allowed:    allowed,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(retryAfterMs) * time.Millisecond,
+		ResetAfter: time.Duration(emissionInterval) * time.Millisecond,
+	}, nil
+}